@@ -12,37 +12,413 @@
 // then a hash that uniquely identifies the test will be appended to the volume
 // name.  This allows tests to run concurrently but avoid contention and
 // potential locking issues when sharing a volume name.
+//
+// "Started" is only logged, and the runner only begins blocking until
+// shutdown, once the `-wait` readiness strategies (if any) report the
+// container ready; see the `-wait` flag for the supported strategy syntax.
+//
+// If `-state-file` is set, a JSON document describing the running
+// container (id, host ports, network names, ...) is written there once
+// the container is ready, and removed on shutdown, so `rules_itest` can
+// discover the container as a first-class service instead of scraping logs.
 package main
 
 import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
+	"github.com/bazelbuild/rules_go/go/tools/bazel"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
 	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
 )
 
 var (
-	name   = flag.String("name", "", "`name`(`:tag`) name and optional tag of the container to launch")
-	volume = flag.String("volume", "", "`name`:`path` pairs of volumes to mount.  If `TEST_TARGET` is set in the environment, that value is hashed and appended to the volume name.  The string `bazel-itest-` is always prepended.")
-	env    = flag.String("env", "", "KEY[,KEY] list of environment variable names to pass through to the container")
-	ports  = flag.String("ports", "", "exposed port mappings to pass to container")
-	labels = flag.String("labels", "", "labels to set on container")
+	name        = flag.String("name", "", "`name`(`:tag`) name and optional tag of the container to launch")
+	volume      = flag.String("volume", "", "`name`:`path`[:`z`|`Z`] pairs of volumes to mount.  If `TEST_TARGET` is set in the environment, that value is hashed and appended to the volume name.  The string `bazel-itest-` is always prepended.  A trailing `z` relabels the volume for shared access by multiple containers; a trailing `Z` relabels it for exclusive access by this container and is rejected if another service is already using the same volume.")
+	env         = flag.String("env", "", "KEY[,KEY] list of environment variable names to pass through to the container")
+	ports       = flag.String("ports", "", "exposed port mappings to pass to container")
+	labels      = flag.String("labels", "", "labels to set on container")
+	waitFor     = flag.String("wait", "", "comma-separated readiness strategies to wait for before declaring the container started: `log:substring`, `http:port/path:status`, `port:number`, `exec:command args...`, or `healthcheck` to defer to the image's own HEALTHCHECK")
+	waitTimeout = flag.Duration("wait-timeout", 60*time.Second, "how long to wait for the -wait strategies to report the container ready")
+
+	memory     = flag.String("memory", "", "memory limit for the container, e.g. `512m` or `1.5g`; unset means no limit")
+	memorySwap = flag.String("memory-swap", "", "total memory+swap limit for the container, e.g. `1g`; unset means unlimited swap if -memory is set")
+	cpus       = flag.String("cpus", "", "number of CPUs the container may use, e.g. `0.5` or `2`; unset means no limit")
+	pidsLimit  = flag.Int64("pids-limit", 0, "maximum number of pids in the container; 0 means no limit")
+	pidMode    = flag.String("pid", "", "PID namespace mode: `host` to share the host's, or `container:<name>` to share another container's; unset means a private namespace")
+	readOnly   = flag.Bool("read-only", false, "mount the container's root filesystem as read-only")
+	tmpfs      = flag.String("tmpfs", "", "comma-separated `path`[:`opts`] tmpfs mounts to create inside the container")
+
+	bind               = flag.String("bind", "", "comma-separated `hostpath`:`containerpath`[:`ro`|`rw`][:`z`|`Z`] bind mounts.  `hostpath` is resolved against the Bazel runfiles tree; see -allow-external-binds.")
+	allowExternalBinds = flag.Bool("allow-external-binds", false, "allow -bind host paths that fall outside the Bazel runfiles tree, instead of failing so tests remain hermetic")
+
+	stateFile = flag.String("state-file", "", "write container metadata (id, ports, network names, ...) as JSON to this `path` once the container is started and ready, for rules_itest to pick up")
 )
 
+// pidAlive reports whether pid still names a running process, so a claim
+// left behind by a SIGKILL'd or otherwise uncleanly terminated itestcontainer
+// process can be recognized as stale rather than trusted forever.
+func pidAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// liveClaimLines reads claimPath, if it exists, and returns only the lines
+// recorded by processes that are still alive; lines left behind by a process
+// that died without releasing its claim are dropped.
+func liveClaimLines(claimPath string) ([]string, error) {
+	existing, err := os.ReadFile(claimPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading SELinux relabel claim %q: %w", claimPath, err)
+	}
+
+	live := make([]string, 0)
+	for _, line := range strings.Split(strings.TrimRight(string(existing), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		_, pidStr, ok := strings.Cut(line, ":")
+		pid, err := strconv.Atoi(pidStr)
+		if !ok || err != nil || !pidAlive(pid) {
+			continue
+		}
+		live = append(live, line)
+	}
+	return live, nil
+}
+
+// parsedVolume is a validated -volume entry, not yet claimed against the
+// SELinux relabel registry.
+type parsedVolume struct {
+	volumeName    string
+	containerPath string
+	relabel       string
+}
+
+// parsedBind is a validated -bind entry, not yet claimed against the SELinux
+// relabel registry.
+type parsedBind struct {
+	hostPath      string
+	containerPath string
+	readOnly      bool
+	relabel       string
+}
+
+// claimVolumeRelabel records, in a well-known location on the host shared by
+// all itestcontainer processes, that volumeName has been mounted with the
+// given SELinux relabel mode ("z" or "Z").  Multiple containers may share a
+// volume with "z" (shared relabel), but "Z" (private relabel) is exclusive:
+// if some other still-running service has already claimed the volume under
+// any mode, the claim is rejected so the Bazel test fails fast instead of
+// racing Docker's relabeling of a volume another running container depends
+// on.  Claims left behind by processes that are no longer running (e.g.
+// SIGKILL'd) are treated as stale and dropped rather than honored.
+func claimVolumeRelabel(volumeName, relabel string) error {
+	dir := filepath.Join(os.TempDir(), "itestcontainer-selinux-volumes")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("creating SELinux relabel claim directory: %w", err)
+	}
+	claimPath := filepath.Join(dir, volumeName+".label")
+
+	live, err := liveClaimLines(claimPath)
+	if err != nil {
+		return err
+	}
+
+	if relabel == "Z" {
+		if len(live) > 0 {
+			return fmt.Errorf("volume %q is already mounted by another service; %q (private) relabel would break that consumer", volumeName, relabel)
+		}
+	} else {
+		for _, line := range live {
+			if strings.HasPrefix(line, "Z:") {
+				return fmt.Errorf("volume %q is already privately relabeled (%q) by another service", volumeName, "Z")
+			}
+		}
+	}
+
+	live = append(live, fmt.Sprintf("%s:%d", relabel, os.Getpid()))
+	if err := os.WriteFile(claimPath, []byte(strings.Join(live, "\n")+"\n"), 0o644); err != nil {
+		return fmt.Errorf("claiming SELinux relabel for volume %q: %w", volumeName, err)
+	}
+	return nil
+}
+
+// releaseVolumeRelabel undoes a prior claimVolumeRelabel by this process, so
+// that a later run reusing the same volume name (e.g. re-running the same
+// Bazel test) does not see a stale claim from this, now-terminated,
+// container.  Only this process's own claim line is removed; other
+// concurrent "z" (shared) consumers of the same volume are left untouched.
+func releaseVolumeRelabel(volumeName string) error {
+	dir := filepath.Join(os.TempDir(), "itestcontainer-selinux-volumes")
+	claimPath := filepath.Join(dir, volumeName+".label")
+
+	existing, err := os.ReadFile(claimPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("reading SELinux relabel claim for volume %q: %w", volumeName, err)
+	}
+
+	pidSuffix := fmt.Sprintf(":%d", os.Getpid())
+	remaining := make([]string, 0)
+	for _, line := range strings.Split(strings.TrimRight(string(existing), "\n"), "\n") {
+		if line == "" || strings.HasSuffix(line, pidSuffix) {
+			continue
+		}
+		remaining = append(remaining, line)
+	}
+
+	if len(remaining) == 0 {
+		if err := os.Remove(claimPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing SELinux relabel claim for volume %q: %w", volumeName, err)
+		}
+		return nil
+	}
+	return os.WriteFile(claimPath, []byte(strings.Join(remaining, "\n")+"\n"), 0o644)
+}
+
+// logTailLines is the number of recent log lines dumped when a wait
+// strategy times out, so `bazel test` output has enough to diagnose why the
+// container never became ready.
+const logTailLines = 50
+
+// parseBytesSize parses a human-readable byte quantity such as "512m" or
+// "1.5g" (suffixes `k`, `m`, `g`, case-insensitive; no suffix means bytes)
+// into a number of bytes.
+func parseBytesSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	multiplier := int64(1)
+	switch suffix := s[len(s)-1]; suffix {
+	case 'k', 'K':
+		multiplier = 1 << 10
+		s = s[:len(s)-1]
+	case 'm', 'M':
+		multiplier = 1 << 20
+		s = s[:len(s)-1]
+	case 'g', 'G':
+		multiplier = 1 << 30
+		s = s[:len(s)-1]
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", s, err)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+// parseNanoCPUs parses a fractional CPU count such as "0.5" or "2" into the
+// nano-CPUs unit used by container.Resources.NanoCPUs.
+func parseNanoCPUs(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid CPU count %q: %w", s, err)
+	}
+	return int64(value * 1e9), nil
+}
+
+// resolveHostPath resolves a -bind host path against the Bazel runfiles
+// tree: first via bazel.Runfile, then by joining it onto RUNFILES_DIR or
+// TEST_SRCDIR, and finally as a literal path if allowExternal is set.  Tests
+// stay hermetic by default because a path that isn't found in the runfiles
+// tree is rejected unless the caller opted into -allow-external-binds.
+func resolveHostPath(path string, allowExternal bool) (string, error) {
+	if resolved, err := bazel.Runfile(path); err == nil {
+		return resolved, nil
+	}
+	for _, env := range []string{"RUNFILES_DIR", "TEST_SRCDIR"} {
+		dir := os.Getenv(env)
+		if dir == "" {
+			continue
+		}
+		candidate := filepath.Join(dir, path)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	if !allowExternal {
+		return "", fmt.Errorf("host path %q not found in the Bazel runfiles tree; pass -allow-external-binds to bind literal host paths", path)
+	}
+	return path, nil
+}
+
+// containerState is the JSON document written to -state-file once the
+// container is started and its wait strategy has passed, so rules_itest can
+// discover the container without scraping logs.
+type containerState struct {
+	ContainerID string            `json:"container_id"`
+	Name        string            `json:"name"`
+	Image       string            `json:"image"`
+	Host        string            `json:"host"`
+	Ports       map[string]string `json:"ports"`
+	IPAddress   string            `json:"ip_address"`
+	Networks    []string          `json:"networks"`
+	Labels      map[string]string `json:"labels"`
+	StartedAt   string            `json:"started_at"`
+}
+
+// writeStateFile marshals state as JSON and writes it to path atomically,
+// by writing to a temporary file in the same directory and renaming it into
+// place, so a reader never observes a partially written file.
+func writeStateFile(path string, state containerState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling container state: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("writing %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("renaming %s to %s: %w", tmp, path, err)
+	}
+	return nil
+}
+
+// buildContainerState gathers the metadata for -state-file from a started
+// container.
+func buildContainerState(ctx context.Context, c testcontainers.Container, image string, exposedPorts []string, labels map[string]string) (containerState, error) {
+	state := containerState{
+		ContainerID: c.GetContainerID(),
+		Image:       image,
+		Ports:       make(map[string]string, len(exposedPorts)),
+		Labels:      labels,
+		StartedAt:   time.Now().UTC().Format(time.RFC3339),
+	}
+
+	host, err := c.Host(ctx)
+	if err != nil {
+		return state, fmt.Errorf("getting container host: %w", err)
+	}
+	state.Host = host
+
+	for _, portSpec := range exposedPorts {
+		mapped, err := c.MappedPort(ctx, nat.Port(portSpec))
+		if err != nil {
+			return state, fmt.Errorf("getting mapped port for %q: %w", portSpec, err)
+		}
+		state.Ports[portSpec] = mapped.Port()
+	}
+
+	inspect, err := c.Inspect(ctx)
+	if err != nil {
+		return state, fmt.Errorf("inspecting container: %w", err)
+	}
+	state.Name = strings.TrimPrefix(inspect.Name, "/")
+	if inspect.NetworkSettings != nil {
+		state.IPAddress = inspect.NetworkSettings.IPAddress
+		for networkName := range inspect.NetworkSettings.Networks {
+			state.Networks = append(state.Networks, networkName)
+		}
+	}
+
+	return state, nil
+}
+
 type logConsumer struct {
+	mu   sync.Mutex
+	tail []string
 }
 
-func (logConsumer) Accept(l testcontainers.Log) {
-	log.Printf("%s: %s", l.LogType, l.Content)
+func (c *logConsumer) Accept(l testcontainers.Log) {
+	line := fmt.Sprintf("%s: %s", l.LogType, l.Content)
+	log.Print(line)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tail = append(c.tail, line)
+	if len(c.tail) > logTailLines {
+		c.tail = c.tail[len(c.tail)-logTailLines:]
+	}
+}
+
+// dumpTail logs the most recently seen container log lines, for use when a
+// wait strategy fails and the container is about to be torn down.
+func (c *logConsumer) dumpTail() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	log.Printf("Last %d lines of container output:", len(c.tail))
+	for _, line := range c.tail {
+		log.Print(line)
+	}
+}
+
+// parseWaitStrategies parses the comma-separated -wait flag value into
+// testcontainers-go wait.Strategy values.
+func parseWaitStrategies(spec string) ([]wait.Strategy, error) {
+	strategies := make([]wait.Strategy, 0)
+	for item := range strings.SplitSeq(spec, ",") {
+		if item == "" {
+			continue
+		}
+		kind, rest, _ := strings.Cut(item, ":")
+		switch kind {
+		case "log":
+			strategies = append(strategies, wait.ForLog(rest))
+		case "port":
+			port := rest
+			if !strings.Contains(port, "/") {
+				port += "/tcp"
+			}
+			strategies = append(strategies, wait.ForListeningPort(nat.Port(port)))
+		case "http":
+			portPath, statusStr, ok := strings.Cut(rest, ":")
+			if !ok {
+				return nil, fmt.Errorf("wait strategy %q: want http:port/path:status", item)
+			}
+			port, path, ok := strings.Cut(portPath, "/")
+			if !ok {
+				path = ""
+			} else {
+				path = "/" + path
+			}
+			status, err := strconv.Atoi(statusStr)
+			if err != nil {
+				return nil, fmt.Errorf("wait strategy %q: invalid status code: %w", item, err)
+			}
+			strategies = append(strategies, wait.ForHTTP(path).
+				WithPort(nat.Port(port+"/tcp")).
+				WithStatusCodeMatcher(func(s int) bool { return s == status }))
+		case "exec":
+			if rest == "" {
+				return nil, fmt.Errorf("wait strategy %q: want exec:command args...", item)
+			}
+			strategies = append(strategies, wait.ForExec(strings.Fields(rest)))
+		case "healthcheck":
+			strategies = append(strategies, wait.ForHealthCheck())
+		default:
+			return nil, fmt.Errorf("wait strategy %q: unknown kind %q", item, kind)
+		}
+	}
+	return strategies, nil
 }
 
 func main() {
@@ -86,25 +462,122 @@ func main() {
 		hB := hasher.Sum(nil)
 		suffix = hex.EncodeToString(hB)
 	}
-	mounts := make([]testcontainers.ContainerMount, 0)
+	// Parse and validate every -volume and -bind entry before claiming any
+	// SELinux relabel, so a syntax error in a later entry can never leave
+	// an earlier entry's relabel claimed with nothing left to release it.
+	volumes := make([]parsedVolume, 0)
 	for volumeMount := range strings.SplitSeq(*volume, ",") {
 		if volumeMount == "" {
 			continue
 		}
-		parts := strings.SplitN(volumeMount, ":", 2)
+		parts := strings.SplitN(volumeMount, ":", 3)
 		volumeName := ""
 		if suffix != "" {
 			volumeName = fmt.Sprintf("bazel-itest-%s-%s", parts[0], suffix)
 		} else {
 			volumeName = fmt.Sprintf("bazel-itest-%s", parts[0])
 		}
+		relabel := ""
+		if len(parts) == 3 {
+			relabel = parts[2]
+			if relabel != "z" && relabel != "Z" {
+				log.Fatalf("-volume %q: unknown relabel option %q, want \"z\" or \"Z\"", volumeMount, relabel)
+			}
+		}
+		volumes = append(volumes, parsedVolume{volumeName: volumeName, containerPath: parts[1], relabel: relabel})
+	}
+
+	binds := make([]parsedBind, 0)
+	for bindMount := range strings.SplitSeq(*bind, ",") {
+		if bindMount == "" {
+			continue
+		}
+		parts := strings.Split(bindMount, ":")
+		if len(parts) < 2 {
+			log.Fatalf("-bind %q: want hostpath:containerpath[:ro|:rw][:z|:Z]", bindMount)
+		}
+		hostPath, containerPath := parts[0], parts[1]
+		readOnlyBind := false
+		relabel := ""
+		for _, opt := range parts[2:] {
+			switch opt {
+			case "ro":
+				readOnlyBind = true
+			case "rw":
+				readOnlyBind = false
+			case "z", "Z":
+				relabel = opt
+			default:
+				log.Fatalf("-bind %q: unknown option %q, want one of ro, rw, z, Z", bindMount, opt)
+			}
+		}
+		resolvedPath, err := resolveHostPath(hostPath, *allowExternalBinds)
+		if err != nil {
+			log.Fatalf("-bind %q: %v", bindMount, err)
+		}
+		binds = append(binds, parsedBind{hostPath: resolvedPath, containerPath: containerPath, readOnly: readOnlyBind, relabel: relabel})
+	}
+
+	mounts := make([]testcontainers.ContainerMount, 0)
+	selinuxBinds := make([]string, 0)
+	claimedRelabels := make([]string, 0)
+	// failClaim releases any relabels already claimed by this invocation
+	// before exiting, so a genuine claim conflict on a later entry doesn't
+	// leak the claims made by earlier, successfully-claimed entries.
+	failClaim := func(format string, args ...any) {
+		for _, volumeName := range claimedRelabels {
+			if err := releaseVolumeRelabel(volumeName); err != nil {
+				log.Printf("releasing SELinux relabel claim for volume %q: %v", volumeName, err)
+			}
+		}
+		log.Fatalf(format, args...)
+	}
+
+	for _, v := range volumes {
+		if v.relabel != "" {
+			if err := claimVolumeRelabel(v.volumeName, v.relabel); err != nil {
+				failClaim("-volume %s:%s:%s: %v", v.volumeName, v.containerPath, v.relabel, err)
+			}
+			claimedRelabels = append(claimedRelabels, v.volumeName)
+			selinuxBinds = append(selinuxBinds, fmt.Sprintf("%s:%s:%s", v.volumeName, v.containerPath, v.relabel))
+			continue
+		}
 		mounts = append(mounts,
 			testcontainers.ContainerMount{
-				Source: testcontainers.GenericVolumeMountSource{Name: volumeName},
-				Target: testcontainers.ContainerMountTarget(parts[1]),
+				Source: testcontainers.GenericVolumeMountSource{Name: v.volumeName},
+				Target: testcontainers.ContainerMountTarget(v.containerPath),
 			})
 	}
 	log.Println("Volume Mounts:", mounts)
+	if len(selinuxBinds) > 0 {
+		log.Println("SELinux-relabeled Volume Mounts:", selinuxBinds)
+	}
+
+	for _, b := range binds {
+		if b.relabel != "" {
+			// The host path contains path separators, so it is hashed into a
+			// flat name for the relabel claim file.
+			pathHash := sha256.Sum256([]byte(b.hostPath))
+			claimName := "bind-" + hex.EncodeToString(pathHash[:])
+			if err := claimVolumeRelabel(claimName, b.relabel); err != nil {
+				failClaim("-bind %s:%s:%s: %v", b.hostPath, b.containerPath, b.relabel, err)
+			}
+			claimedRelabels = append(claimedRelabels, claimName)
+			ro := ""
+			if b.readOnly {
+				ro = "ro,"
+			}
+			selinuxBinds = append(selinuxBinds, fmt.Sprintf("%s:%s:%s%s", b.hostPath, b.containerPath, ro, b.relabel))
+			continue
+		}
+		mounts = append(mounts,
+			testcontainers.ContainerMount{
+				Source:   testcontainers.GenericBindMountSource{HostPath: b.hostPath},
+				Target:   testcontainers.ContainerMountTarget(b.containerPath),
+				ReadOnly: b.readOnly,
+			})
+	}
+	log.Println("Bind Mounts:", *bind)
 
 	labelMap := make(map[string]string, 0)
 	for label := range strings.SplitSeq(*labels, ",") {
@@ -116,31 +589,135 @@ func main() {
 	}
 	log.Println("Labels:", labelMap)
 
-	logConsumer := logConsumer{}
+	waitStrategies, err := parseWaitStrategies(*waitFor)
+	if err != nil {
+		log.Fatalf("-wait: %v", err)
+	}
 
-	c, err := testcontainers.Run(ctx, *name,
+	memoryBytes, err := parseBytesSize(*memory)
+	if err != nil {
+		log.Fatalf("-memory: %v", err)
+	}
+	// Docker requires MemorySwap to be -1 (unlimited) or >= Memory; if left
+	// at the zero value while -memory is set, container creation is
+	// rejected.  Default to -1 so an unset -memory-swap means "unlimited
+	// swap" as documented, rather than failing every -memory-only run.
+	memorySwapBytes := int64(-1)
+	if *memorySwap != "" {
+		memorySwapBytes, err = parseBytesSize(*memorySwap)
+		if err != nil {
+			log.Fatalf("-memory-swap: %v", err)
+		}
+	}
+	nanoCPUs, err := parseNanoCPUs(*cpus)
+	if err != nil {
+		log.Fatalf("-cpus: %v", err)
+	}
+	tmpfsMounts := make(map[string]string, 0)
+	for spec := range strings.SplitSeq(*tmpfs, ",") {
+		if spec == "" {
+			continue
+		}
+		path, tmpfsOpts, _ := strings.Cut(spec, ":")
+		tmpfsMounts[path] = tmpfsOpts
+	}
+	log.Printf("Resource limits: memory=%d memory-swap=%d nano-cpus=%d pids-limit=%d pid=%q read-only=%t tmpfs=%v",
+		memoryBytes, memorySwapBytes, nanoCPUs, *pidsLimit, *pidMode, *readOnly, tmpfsMounts)
+
+	logConsumer := &logConsumer{}
+
+	opts := []testcontainers.ContainerCustomizer{
 		testcontainers.WithExposedPorts(exposedPorts...),
 		testcontainers.WithLogConsumers(logConsumer),
 		testcontainers.WithEnv(environment),
 		testcontainers.WithMounts(mounts...),
 		testcontainers.WithLabels(labelMap),
-	)
+		testcontainers.WithHostConfigModifier(func(hc *container.HostConfig) {
+			hc.Binds = append(hc.Binds, selinuxBinds...)
+			hc.Memory = memoryBytes
+			hc.MemorySwap = memorySwapBytes
+			hc.NanoCPUs = nanoCPUs
+			if *pidsLimit != 0 {
+				hc.PidsLimit = pidsLimit
+			}
+			if *pidMode != "" {
+				hc.PidMode = container.PidMode(*pidMode)
+			}
+			hc.ReadonlyRootfs = *readOnly
+			hc.Tmpfs = tmpfsMounts
+		}),
+	}
+	if len(waitStrategies) > 0 {
+		opts = append(opts, testcontainers.WithWaitStrategy(
+			wait.ForAll(waitStrategies...).WithStartupTimeoutDefault(*waitTimeout)))
+	}
+
+	c, err := testcontainers.Run(ctx, *name, opts...)
 	if err != nil {
+		logConsumer.dumpTail()
+		// testcontainers.Run can return a non-nil container alongside an
+		// error (e.g. a -wait strategy that times out after the container
+		// is already running), so it must still be torn down here or it
+		// leaks with nothing left to clean it up.
+		if c != nil {
+			testcontainers.TerminateContainer(c)
+		}
+		for _, volumeName := range claimedRelabels {
+			if relErr := releaseVolumeRelabel(volumeName); relErr != nil {
+				log.Printf("releasing SELinux relabel claim for volume %q: %v", volumeName, relErr)
+			}
+		}
 		log.Fatalf("testcontainers.Run(%v): %v", *name, err)
 	}
+	// shutdown tears down the container and everything this process claimed
+	// on its behalf.  It is used both by the goroutine below, once ctx is
+	// done, and by the -state-file error paths below, which run after the
+	// container has already started and must not leave it orphaned.
+	shutdown := func() {
+		containerName := c.GetContainerID()
+		n, err := c.Inspect(ctx)
+		if err == nil {
+			containerName = n.Name
+		}
+		log.Println("Stopping ", containerName)
+		testcontainers.TerminateContainer(c)
+		if *stateFile != "" {
+			if err := os.Remove(*stateFile); err != nil && !os.IsNotExist(err) {
+				log.Printf("removing %s: %v", *stateFile, err)
+			}
+		}
+		for _, volumeName := range claimedRelabels {
+			if err := releaseVolumeRelabel(volumeName); err != nil {
+				log.Printf("releasing SELinux relabel claim for volume %q: %v", volumeName, err)
+			}
+		}
+	}
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		name := c.GetContainerID()
-		n, err := c.Inspect(ctx)
-		if err != nil {
-			name = n.Name
-		}
 		<-ctx.Done()
-		log.Println("Stopping ", name)
-		testcontainers.TerminateContainer(c)
+		shutdown()
 	}()
 	log.Println("Started", *name)
+
+	if *stateFile != "" {
+		state, err := buildContainerState(ctx, c, *name, exposedPorts, labelMap)
+		if err != nil {
+			log.Printf("building container state: %v", err)
+			shutdown()
+			stop()
+			os.Exit(1)
+		}
+		if err := writeStateFile(*stateFile, state); err != nil {
+			log.Printf("writing -state-file: %v", err)
+			shutdown()
+			stop()
+			os.Exit(1)
+		}
+		log.Println("Wrote container state to", *stateFile)
+	}
+
 	log.Println("Waiting, press Ctrl-C to shutdown")
 	<-ctx.Done()
 	stop()